@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	jwtware "github.com/gofiber/contrib/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Client adalah kredensial multi-tenant yang disimpan di koleksi `clients`,
+// dipakai untuk mengotentikasi caller /send-token dan /send-notification
+// serta membatasi topic/user mana saja yang boleh dikirimi.
+type Client struct {
+	ClientID         string   `firestore:"clientId" json:"clientId"`
+	ClientSecretHash string   `firestore:"clientSecretHash" json:"-"`
+	AllowedTopics    []string `firestore:"allowedTopics" json:"allowedTopics"`
+	AllowedUserIDs   []string `firestore:"allowedUserIds" json:"allowedUserIds"`
+	ProjectID        string   `firestore:"projectId" json:"projectId"`
+}
+
+// allowsTopic memeriksa apakah client boleh mengirim ke topic tertentu.
+// Topic kosong (mis. pengiriman by token) selalu diizinkan.
+func (client *Client) allowsTopic(topic string) bool {
+	if topic == "" {
+		return true
+	}
+	for _, t := range client.AllowedTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsUser memeriksa apakah client boleh mengirim atas nama userId
+// tertentu. Jika AllowedUserIDs kosong, client tidak dibatasi per user.
+func (client *Client) allowsUser(userID string) bool {
+	if userID == "" || len(client.AllowedUserIDs) == 0 {
+		return true
+	}
+	for _, u := range client.AllowedUserIDs {
+		if u == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsCondition menolak pengiriman lewat condition expression untuk
+// client yang dibatasi ke topic tertentu. allowsTopic tidak pernah melihat
+// isi condition, jadi tanpa pemeriksaan ini client yang dibatasi bisa
+// menyasar topic yang sama lewat string condition (mis. "'topicA' in
+// topics") dan melewati pembatasan AllowedTopics sepenuhnya.
+func (client *Client) allowsCondition(condition string) bool {
+	if condition == "" {
+		return true
+	}
+	return len(client.AllowedTopics) == 0
+}
+
+// hashClientSecret menurunkan client_secret_hash yang disimpan di Firestore.
+// Nilai ini dipakai ganda: dibandingkan langsung untuk auth client_id +
+// client_secret di body, dan (setelah di-decode dari hex, yaitu 32 byte
+// SHA-256 dari client_secret) dipakai sebagai HMAC key saat memverifikasi
+// JWT HS256. Client karenanya menandatangani JWT dengan byte SHA-256 dari
+// client_secret-nya, bukan dengan client_secret mentah.
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateClientSecret membuat client_secret acak yang hanya ditampilkan
+// sekali ke admin saat registrasi.
+func generateClientSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("membuat client secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// getClient mengambil dokumen client dari Firestore berdasarkan clientID.
+func getClient(ctx context.Context, clientID string) (*Client, error) {
+	snap, err := firestoreClient.Collection("clients").Doc(clientID).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var client Client
+	if err := snap.DataTo(&client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// RegisterClientRequest adalah body untuk POST /clients.
+type RegisterClientRequest struct {
+	ClientID       string   `json:"clientId" validate:"required"`
+	ProjectID      string   `json:"projectId" validate:"required"`
+	AllowedTopics  []string `json:"allowedTopics"`
+	AllowedUserIDs []string `json:"allowedUserIds"`
+}
+
+// requireAdminAuth mengotentikasi POST /clients dengan API key admin statis
+// dari environment ADMIN_API_KEY, supaya pendaftaran client multi-tenant
+// (yang bisa melewati semua pembatasan topic/user) tidak bisa dilakukan
+// sembarang orang.
+func requireAdminAuth(c *fiber.Ctx) error {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	if adminKey == "" {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "ADMIN_API_KEY belum dikonfigurasi",
+		})
+	}
+
+	provided := c.Get("X-Admin-Api-Key")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(adminKey)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Admin API key tidak valid",
+		})
+	}
+
+	return c.Next()
+}
+
+// endpoint admin POST /clients
+func registerClientHandler(c *fiber.Ctx) error {
+	req := new(RegisterClientRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	secret, err := generateClientSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Gagal membuat client secret",
+			"error":   err.Error(),
+		})
+	}
+
+	client := Client{
+		ClientID:         req.ClientID,
+		ClientSecretHash: hashClientSecret(secret),
+		AllowedTopics:    req.AllowedTopics,
+		AllowedUserIDs:   req.AllowedUserIDs,
+		ProjectID:        req.ProjectID,
+	}
+
+	ctx := context.Background()
+	if _, err := firestoreClient.Collection("clients").Doc(client.ClientID).Set(ctx, client); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Gagal mendaftarkan client",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":      "Client terdaftar",
+		"clientId":     client.ClientID,
+		"clientSecret": secret,
+	})
+}
+
+// clientCredentials adalah body client_id/client_secret ala Passport
+// notifyUser yang jadi alternatif dari JWT bearer.
+type clientCredentials struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// authenticateCredentials mengotentikasi request lewat client_id dan
+// client_secret, dibaca dari query string (GET /notifications, upgrade
+// WebSocket /ws/notifications, karena keduanya tidak mengirim body) atau,
+// jika tidak lengkap di query string, dari body JSON (POST /send-token,
+// /send-notification).
+func authenticateCredentials(c *fiber.Ctx) (*Client, error) {
+	creds := clientCredentials{
+		ClientID:     c.Query("client_id"),
+		ClientSecret: c.Query("client_secret"),
+	}
+	if creds.ClientID == "" || creds.ClientSecret == "" {
+		_ = c.BodyParser(&creds)
+	}
+	if creds.ClientID == "" || creds.ClientSecret == "" {
+		return nil, fmt.Errorf("client_id/client_secret tidak ditemukan")
+	}
+
+	client, err := getClient(context.Background(), creds.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("client tidak ditemukan: %w", err)
+	}
+
+	expected := hashClientSecret(creds.ClientSecret)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(client.ClientSecretHash)) != 1 {
+		return nil, fmt.Errorf("client_secret tidak valid")
+	}
+
+	return client, nil
+}
+
+// jwtClientKeyFunc memilih HMAC key untuk memverifikasi JWT berdasarkan
+// claim `clientId` yang sudah terbaca (tapi belum diverifikasi) di token,
+// sehingga setiap client memakai key-nya sendiri: byte SHA-256 dari
+// client_secret-nya (client_secret_hash yang di-decode dari hex).
+func jwtClientKeyFunc(token *jwt.Token) (interface{}, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("klaim JWT tidak valid")
+	}
+
+	clientID, _ := claims["clientId"].(string)
+	if clientID == "" {
+		return nil, fmt.Errorf("klaim clientId tidak ada")
+	}
+
+	client, err := getClient(context.Background(), clientID)
+	if err != nil {
+		return nil, fmt.Errorf("client tidak ditemukan: %w", err)
+	}
+
+	keyBytes, err := hex.DecodeString(client.ClientSecretHash)
+	if err != nil {
+		return nil, fmt.Errorf("client_secret_hash tidak valid")
+	}
+
+	return keyBytes, nil
+}
+
+// jwtClientAuth adalah middleware JWT yang hanya aktif ketika header
+// Authorization ada, sehingga request tanpa header bisa lanjut mencoba
+// auth client_id/client_secret di requireClientAuth.
+var jwtClientAuth = jwtware.New(jwtware.Config{
+	SigningKey: jwtware.SigningKey{JWTAlg: jwtware.HS256},
+	KeyFunc:    jwtClientKeyFunc,
+	Filter: func(c *fiber.Ctx) bool {
+		return c.Get(fiber.HeaderAuthorization) == ""
+	},
+	SuccessHandler: func(c *fiber.Ctx) error {
+		token := c.Locals("user").(*jwt.Token)
+		claims := token.Claims.(jwt.MapClaims)
+		clientID, _ := claims["clientId"].(string)
+
+		client, err := getClient(context.Background(), clientID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Client tidak ditemukan",
+			})
+		}
+
+		c.Locals("client", client)
+		return c.Next()
+	},
+	ErrorHandler: func(c *fiber.Ctx, err error) error {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Token JWT tidak valid",
+			"error":   err.Error(),
+		})
+	},
+})
+
+// requireClientAuth mengotentikasi caller /send-token dan /send-notification
+// lewat JWT bearer (ditangani jwtClientAuth di atas) atau, jika tidak ada
+// header Authorization, lewat client_id/client_secret di body.
+func requireClientAuth(c *fiber.Ctx) error {
+	if _, ok := c.Locals("client").(*Client); ok {
+		return c.Next()
+	}
+
+	client, err := authenticateCredentials(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+			"error":   err.Error(),
+		})
+	}
+
+	c.Locals("client", client)
+	return c.Next()
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestHashClientSecret_DeterministicAndDistinct(t *testing.T) {
+	a1 := hashClientSecret("secret-a")
+	a2 := hashClientSecret("secret-a")
+	b := hashClientSecret("secret-b")
+
+	if a1 != a2 {
+		t.Fatalf("hashClientSecret should be deterministic, got %q and %q", a1, a2)
+	}
+	if a1 == b {
+		t.Fatal("hashClientSecret should differ for different secrets")
+	}
+}
+
+func TestClient_AllowsTopic(t *testing.T) {
+	client := &Client{AllowedTopics: []string{"news", "promo"}}
+
+	if !client.allowsTopic("") {
+		t.Fatal("empty topic should always be allowed")
+	}
+	if !client.allowsTopic("news") {
+		t.Fatal("expected topic in AllowedTopics to be permitted")
+	}
+	if client.allowsTopic("other") {
+		t.Fatal("expected topic outside AllowedTopics to be rejected")
+	}
+}
+
+func TestClient_AllowsUser(t *testing.T) {
+	unrestricted := &Client{}
+	if !unrestricted.allowsUser("anyone") {
+		t.Fatal("client with no AllowedUserIDs should not restrict users")
+	}
+
+	restricted := &Client{AllowedUserIDs: []string{"u1", "u2"}}
+	if !restricted.allowsUser("u1") {
+		t.Fatal("expected user in AllowedUserIDs to be permitted")
+	}
+	if restricted.allowsUser("u3") {
+		t.Fatal("expected user outside AllowedUserIDs to be rejected")
+	}
+}
+
+func TestClient_AllowsCondition(t *testing.T) {
+	unrestricted := &Client{}
+	if !unrestricted.allowsCondition("'news' in topics") {
+		t.Fatal("client with no AllowedTopics should allow condition sends")
+	}
+
+	scoped := &Client{AllowedTopics: []string{"news"}}
+	if scoped.allowsCondition("'news' in topics") {
+		t.Fatal("topic-scoped client should not be able to bypass scoping via condition")
+	}
+	if !scoped.allowsCondition("") {
+		t.Fatal("empty condition should always be allowed, regardless of scoping")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Scope OAuth2 yang dibutuhkan untuk memanggil FCM HTTP v1 API.
+const fcmMessagingScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// Ambang batas waktu sebelum kedaluwarsa agar token dianggap perlu di-refresh,
+// supaya request tidak gagal karena token kadaluarsa di tengah jalan.
+const tokenExpirySkew = 60 * time.Second
+
+// FCMClient membungkus kredensial Service Account dan HTTP client Resty,
+// dibuat satu kali di main dan dipakai ulang untuk setiap request FCM
+// sehingga access token OAuth2 bisa di-cache sampai kedaluwarsa.
+type FCMClient struct {
+	resty       *resty.Client
+	projectID   string
+	tokenSource oauth2.TokenSource
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// NewFCMClient membaca file Service Account JSON dan menyiapkan TokenSource
+// OAuth2 dengan scope firebase.messaging.
+func NewFCMClient(ctx context.Context, serviceAccountKeyPath, projectID string) (*FCMClient, error) {
+	keyData, err := os.ReadFile(serviceAccountKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("membaca service account key: %w", err)
+	}
+
+	creds, err := google.CredentialsFromJSON(ctx, keyData, fcmMessagingScope)
+	if err != nil {
+		return nil, fmt.Errorf("memparse kredensial service account: %w", err)
+	}
+
+	return &FCMClient{
+		resty:       resty.New(),
+		projectID:   projectID,
+		tokenSource: creds.TokenSource,
+	}, nil
+}
+
+// accessToken mengembalikan access token yang masih valid, mengambil token
+// baru dari tokenSource jika cache kosong, sudah mendekati kedaluwarsa, atau
+// forceRefresh diminta (dipakai saat FCM membalas 401).
+func (f *FCMClient) accessToken(ctx context.Context, forceRefresh bool) (string, error) {
+	ctx, span := tracer.Start(ctx, "fcm.access_token")
+	defer span.End()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !forceRefresh && f.token != nil && time.Until(f.token.Expiry) > tokenExpirySkew {
+		return f.token.AccessToken, nil
+	}
+
+	token, err := f.tokenSource.Token()
+	if err != nil {
+		span.RecordError(err)
+		return "", fmt.Errorf("mengambil access token FCM: %w", err)
+	}
+
+	f.token = token
+	return token.AccessToken, nil
+}
+
+// Send mengirim satu notifikasi FCM v1 ke sebuah token, menggunakan access
+// token OAuth2 yang di-cache, dan mencoba ulang sekali dengan token baru jika
+// FCM membalas 401.
+func (f *FCMClient) Send(ctx context.Context, notif *NotificationRequest) (map[string]interface{}, error) {
+	return f.sendTo(ctx, "token", notif.Token, notif)
+}
+
+// SendToTopic mengirim notifikasi ke semua subscriber sebuah topic.
+func (f *FCMClient) SendToTopic(ctx context.Context, topic string, notif *NotificationRequest) (map[string]interface{}, error) {
+	return f.sendTo(ctx, "topic", topic, notif)
+}
+
+// SendToCondition mengirim notifikasi ke token-token yang cocok dengan
+// condition expression FCM (mis. "'topicA' in topics && 'topicB' in topics").
+func (f *FCMClient) SendToCondition(ctx context.Context, condition string, notif *NotificationRequest) (map[string]interface{}, error) {
+	return f.sendTo(ctx, "condition", condition, notif)
+}
+
+// TokenSendResult merangkum hasil pengiriman ke satu token agar caller bisa
+// membuang token yang sudah tidak valid.
+type TokenSendResult struct {
+	Token     string `json:"token"`
+	Success   bool   `json:"success"`
+	MessageID string `json:"messageId,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SendToTokens mengirim notifikasi yang sama ke banyak token sekaligus secara
+// konkuren, lalu mengumpulkan hasilnya per token seperti semantik batch FCM.
+func (f *FCMClient) SendToTokens(ctx context.Context, tokens []string, notif *NotificationRequest) []TokenSendResult {
+	results := make([]TokenSendResult, len(tokens))
+
+	var wg sync.WaitGroup
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+
+			result := TokenSendResult{Token: token}
+			resp, err := f.sendTo(ctx, "token", token, notif)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Success = true
+				if name, ok := resp["name"].(string); ok {
+					result.MessageID = name
+				}
+			}
+
+			results[i] = result
+		}(i, token)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// sendTo mengirim satu pesan FCM v1 ke target (token/topic/condition) yang
+// ditentukan oleh targetField, dan mencoba ulang sekali dengan token OAuth2
+// baru jika FCM membalas 401. Mencatat span serta metrik fcm_send_total dan
+// fcm_send_latency_seconds untuk satu pesan ini.
+func (f *FCMClient) sendTo(ctx context.Context, targetField, targetValue string, notif *NotificationRequest) (map[string]interface{}, error) {
+	ctx, span := tracer.Start(ctx, "fcm.send")
+	defer span.End()
+
+	start := time.Now()
+	result, err := f.doSendWithRetry(ctx, targetField, targetValue, notif)
+
+	result2 := "success"
+	if err != nil {
+		result2 = "error"
+		span.RecordError(err)
+	}
+	fcmSendTotal.WithLabelValues(result2).Inc()
+	fcmSendLatency.WithLabelValues(result2).Observe(time.Since(start).Seconds())
+
+	return result, err
+}
+
+// doSendWithRetry menjalankan sendTo tanpa instrumentasi metrik, dipisah agar
+// sendTo bisa mengukur latensi end-to-end termasuk percobaan ulang 401.
+func (f *FCMClient) doSendWithRetry(ctx context.Context, targetField, targetValue string, notif *NotificationRequest) (map[string]interface{}, error) {
+	payload := map[string]interface{}{
+		"message": map[string]interface{}{
+			targetField: targetValue,
+			"notification": map[string]string{
+				"title": notif.Title,
+				"body":  notif.Body,
+			},
+			"data": notif.Data,
+		},
+	}
+
+	result, resp, err := f.doSend(ctx, payload, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() == fiber.StatusUnauthorized {
+		result, resp, err = f.doSend(ctx, payload, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.IsError() {
+		return nil, newFCMError(resp)
+	}
+
+	return result, nil
+}
+
+// doSend menjalankan satu HTTP call ke FCM dengan bearer token saat ini
+// (atau yang baru, jika forceRefresh diminta), dan menyisipkan trace context
+// saat ini ke header HTTP agar bisa disambung di sisi penerima.
+func (f *FCMClient) doSend(ctx context.Context, payload map[string]interface{}, forceRefresh bool) (map[string]interface{}, *resty.Response, error) {
+	token, err := f.accessToken(ctx, forceRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := f.resty.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Authorization", "Bearer "+token)
+	injectTraceHeaders(ctx, req)
+
+	var result map[string]interface{}
+	resp, err := req.
+		SetBody(payload).
+		SetResult(&result).
+		Post("https://fcm.googleapis.com/v1/projects/" + f.projectID + "/messages:send")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, resp, nil
+}
+
+// FCMError membawa status code dan Retry-After dari respons error FCM,
+// supaya pemanggil (mis. worker pengiriman async) bisa memutuskan apakah
+// error itu layak dicoba ulang.
+type FCMError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *FCMError) Error() string {
+	return fmt.Sprintf("FCM membalas %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable menandai error 429 (rate limit) dan 5xx (kegagalan sementara di
+// sisi Google) sebagai layak dicoba ulang.
+func (e *FCMError) Retryable() bool {
+	return e.StatusCode == fiber.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func newFCMError(resp *resty.Response) *FCMError {
+	return &FCMError{
+		StatusCode: resp.StatusCode(),
+		Body:       resp.String(),
+		RetryAfter: parseRetryAfter(resp.Header().Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter mem-parse header Retry-After dalam bentuk detik (FCM tidak
+// memakai format HTTP-date untuk header ini).
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// stubTokenSource mengembalikan token dari daftar tetap secara berurutan,
+// tanpa pernah melewati elemen terakhir, supaya test bisa memeriksa berapa
+// kali accessToken benar-benar mengambil token baru. invocations dihitung
+// terpisah dari index supaya tetap akurat walau daftar token sudah habis.
+type stubTokenSource struct {
+	tokens      []*oauth2.Token
+	index       int
+	invocations int
+}
+
+func (s *stubTokenSource) Token() (*oauth2.Token, error) {
+	s.invocations++
+	token := s.tokens[s.index]
+	if s.index < len(s.tokens)-1 {
+		s.index++
+	}
+	return token, nil
+}
+
+func TestFCMClient_AccessToken_CachesUntilExpirySkew(t *testing.T) {
+	stub := &stubTokenSource{tokens: []*oauth2.Token{
+		{AccessToken: "first", Expiry: time.Now().Add(5 * time.Minute)},
+		{AccessToken: "second", Expiry: time.Now().Add(5 * time.Minute)},
+	}}
+	client := &FCMClient{tokenSource: stub}
+
+	got, err := client.accessToken(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "first" {
+		t.Fatalf("accessToken() = %q, want %q", got, "first")
+	}
+
+	got, err = client.accessToken(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "first" {
+		t.Fatalf("accessToken() should reuse cached token, got %q", got)
+	}
+	if stub.invocations != 1 {
+		t.Fatalf("tokenSource.Token() called %d times, want 1", stub.invocations)
+	}
+}
+
+func TestFCMClient_AccessToken_RefreshesNearExpiry(t *testing.T) {
+	stub := &stubTokenSource{tokens: []*oauth2.Token{
+		{AccessToken: "near-expiry", Expiry: time.Now().Add(tokenExpirySkew / 2)},
+		{AccessToken: "refreshed", Expiry: time.Now().Add(5 * time.Minute)},
+	}}
+	client := &FCMClient{tokenSource: stub}
+
+	got, err := client.accessToken(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "near-expiry" {
+		t.Fatalf("accessToken() = %q, want %q", got, "near-expiry")
+	}
+
+	got, err = client.accessToken(context.Background(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "refreshed" {
+		t.Fatalf("accessToken() should refresh once cached token is within skew, got %q", got)
+	}
+}
+
+func TestFCMClient_AccessToken_ForceRefreshIgnoresCache(t *testing.T) {
+	stub := &stubTokenSource{tokens: []*oauth2.Token{
+		{AccessToken: "first", Expiry: time.Now().Add(5 * time.Minute)},
+		{AccessToken: "second", Expiry: time.Now().Add(5 * time.Minute)},
+	}}
+	client := &FCMClient{tokenSource: stub}
+
+	if _, err := client.accessToken(context.Background(), false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := client.accessToken(context.Background(), true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "second" {
+		t.Fatalf("accessToken(forceRefresh=true) = %q, want %q", got, "second")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"empty header", "", 0},
+		{"valid seconds", "30", 30 * time.Second},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-5", 0},
+		{"http-date format unsupported", "Wed, 21 Oct 2026 07:28:00 GMT", 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseRetryAfter(tc.header); got != tc.want {
+				t.Fatalf("parseRetryAfter(%q) = %v, want %v", tc.header, got, tc.want)
+			}
+		})
+	}
+}
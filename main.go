@@ -2,12 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 
 	"cloud.google.com/go/firestore"
 	"github.com/go-playground/validator/v10"
-	"github.com/go-resty/resty/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
@@ -21,15 +21,32 @@ type User struct {
 }
 
 type NotificationRequest struct {
-	Token string            `json:"token" validate:"required"`
-	Title string            `json:"title" validate:"required"`
-	Body  string            `json:"body" validate:"required"`
-	Data  map[string]string `json:"data"`
+	Token       string            `json:"token" validate:"required_without_all=Tokens Topic Condition"`
+	Tokens      []string          `json:"tokens" validate:"required_without_all=Token Topic Condition"`
+	Topic       string            `json:"topic" validate:"required_without_all=Token Tokens Condition"`
+	Condition   string            `json:"condition" validate:"required_without_all=Token Tokens Topic"`
+	Title       string            `json:"title" validate:"required"`
+	Body        string            `json:"body" validate:"required"`
+	Data        map[string]string `json:"data"`
+	UserID      string            `json:"userId"`
+	IsImportant bool              `json:"isImportant"`
+	IsRealtime  bool              `json:"isRealtime"`
+}
+
+// SendResult adalah bentuk respons terpadu untuk /send-notification, dengan
+// successCount/failureCount seperti semantik batch FCM sehingga klien bisa
+// membuang token yang sudah tidak valid.
+type SendResult struct {
+	SuccessCount int                    `json:"successCount"`
+	FailureCount int                    `json:"failureCount"`
+	Results      []TokenSendResult      `json:"results,omitempty"`
+	Response     map[string]interface{} `json:"response,omitempty"`
 }
 
 var (
 	validate        = validator.New()
 	firestoreClient *firestore.Client
+	fcmClient       *FCMClient
 )
 
 func main() {
@@ -54,17 +71,61 @@ func main() {
 	}
 	defer firestoreClient.Close()
 
+	// Inisialisasi FCMClient satu kali agar access token OAuth2 di-cache
+	// dan tidak dibuat ulang untuk setiap request.
+	fcmClient, err = NewFCMClient(ctx, serviceAccountKeyPath, os.Getenv("FIREBASE_PROJECT_ID"))
+	if err != nil {
+		log.Fatalf("Failed to create FCM client: %v", err)
+	}
+
+	// Jalankan worker pool untuk pengiriman FCM async.
+	startDeliveryWorkers(deliveryWorkerCount)
+
 	app := fiber.New()
 
 	// Middleware
 	app.Use(logger.New())
 	app.Use(recover.New())
+	app.Use(tracingMiddleware())
+
+	// Route untuk metrik Prometheus.
+	app.Get("/metrics", metricsHandler())
+
+	// Route untuk mendaftarkan client multi-tenant (client_id/client_secret).
+	// Membutuhkan ADMIN_API_KEY supaya tidak bisa dipakai sembarang orang
+	// untuk mencetak kredensial baru.
+	app.Post("/clients", requireAdminAuth, registerClientHandler)
+
+	// Route untuk menyimpan token FCM ke Firestore. Membutuhkan auth client
+	// lewat JWT bearer atau client_id/client_secret di body.
+	app.Post("/send-token", jwtClientAuth, requireClientAuth, sendTokenHandler)
+
+	// Route untuk mengirim notifikasi ke pengguna. Membutuhkan auth client
+	// yang sama, dan dibatasi ke topic/user yang diizinkan untuk client itu.
+	app.Post("/send-notification", jwtClientAuth, requireClientAuth, sendNotificationHandler)
+
+	// Route untuk mengelola keanggotaan topic FCM. Membutuhkan auth client
+	// yang sama dengan /send-notification, dan dibatasi ke topic yang
+	// diizinkan untuk client itu, supaya client tidak bisa subscribe/
+	// unsubscribe token sembarang orang ke topic di luar izinnya.
+	app.Post("/subscribe", jwtClientAuth, requireClientAuth, subscribeHandler)
+	app.Post("/unsubscribe", jwtClientAuth, requireClientAuth, unsubscribeHandler)
+
+	// Route untuk inbox notifikasi yang tersimpan di Firestore. Membutuhkan
+	// auth client yang sama dengan /send-notification, dan dibatasi ke
+	// userId yang diizinkan untuk client itu, supaya client tidak bisa
+	// membaca/menandai inbox milik user lain.
+	app.Get("/notifications", jwtClientAuth, requireClientAuth, listNotificationsHandler)
+	app.Post("/notifications/:id/read", jwtClientAuth, requireClientAuth, markNotificationReadHandler)
+	app.Post("/notifications/read-all", jwtClientAuth, requireClientAuth, markAllNotificationsReadHandler)
 
-	// Route untuk menyimpan token FCM ke Firestore.
-	app.Post("/send-token", sendTokenHandler)
+	// Route untuk jalur pengiriman realtime lewat WebSocket.
+	app.Use("/ws/notifications", wsUpgradeMiddleware)
+	app.Get("/ws/notifications", wsNotificationsHandler())
 
-	// Route untuk mengirim notifikasi ke pengguna.
-	app.Post("/send-notification", sendNotificationHandler)
+	// Route untuk memeriksa status pengiriman async. Dibatasi ke client yang
+	// mengantrekan pesan itu (lihat getMessageStatusHandler).
+	app.Get("/messages/:id", jwtClientAuth, requireClientAuth, getMessageStatusHandler)
 
 	// Jalankan server
 	port := os.Getenv("PORT")
@@ -92,10 +153,12 @@ func sendTokenHandler(c *fiber.Ctx) error {
 	}
 
 	// Simpan token ke Firestore
-	ctx := context.Background()
-	_, err := firestoreClient.Collection("users").Doc(user.UserID).Set(ctx, fiber.Map{
-		"fcmToken": user.Token,
-	}, firestore.MergeAll)
+	err := withFirestoreSpan(context.Background(), "send_token", func(ctx context.Context) error {
+		_, err := firestoreClient.Collection("users").Doc(user.UserID).Set(ctx, fiber.Map{
+			"fcmToken": user.Token,
+		}, firestore.MergeAll)
+		return err
+	})
 	if err != nil {
 		log.Printf("Error saving token to Firestore: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -126,58 +189,114 @@ func sendNotificationHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Kirim notifikasi melalui FCM
-	response, err := sendFCMNotification(notif)
-	if err != nil {
-		log.Printf("Error sending notification: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Gagal mengirim notifikasi",
-			"error":   err.Error(),
+	// Batasi pengiriman ke topic/user yang diizinkan untuk client yang
+	// terotentikasi. allowsCondition menolak condition-based send untuk
+	// client yang dibatasi topic, karena condition bisa menyasar topic yang
+	// sama tanpa pernah melewati allowsTopic.
+	client := c.Locals("client").(*Client)
+	if !client.allowsTopic(notif.Topic) || !client.allowsUser(notif.UserID) || !client.allowsCondition(notif.Condition) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Client tidak diizinkan mengirim ke topic/user ini",
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message":  "Notifikasi terkirim",
-		"response": response,
-	})
-}
+	// Simpan salinan notifikasi ke inbox Firestore milik userId, jika diisi.
+	if notif.UserID != "" {
+		if err := saveNotification(context.Background(), notif.UserID, notif); err != nil {
+			log.Printf("Error saving notification to inbox: %v\n", err)
+		}
+	}
 
-func sendFCMNotification(notif *NotificationRequest) (map[string]interface{}, error) {
-	// Ambil jalur ke file Service Account dari variabel lingkungan
-	serviceAccountKeyPath := os.Getenv("SERVICE_ACCOUNT_KEY_PATH")
-	if serviceAccountKeyPath == "" {
-		return nil, fiber.NewError(fiber.StatusInternalServerError, "SERVICE_ACCOUNT_KEY_PATH not set")
+	// Jika IsRealtime, dorong juga ke setiap socket WebSocket yang terbuka
+	// untuk userId ini, di samping pengiriman lewat FCM di bawah.
+	if notif.IsRealtime && notif.UserID != "" {
+		hub.broadcast(notif.UserID, fiber.Map{
+			"title": notif.Title,
+			"body":  notif.Body,
+			"data":  notif.Data,
+			"topic": notif.Topic,
+		})
 	}
 
-	client := resty.New()
+	// Multicast ke banyak token selalu dikirim langsung (sudah konkuren per
+	// token), karena worker async di bawah hanya menangani satu target.
+	if len(notif.Tokens) > 0 {
+		return sendMulticast(c, notif)
+	}
+
+	// Selain multicast, default-nya dikirim lewat worker pool async supaya
+	// latensi caller tidak tergantung latensi FCM; ?async=false memaksa
+	// jalur lama yang langsung memanggil FCM dan menunggu balasannya.
+	if c.QueryBool("async", true) {
+		messageID, err := enqueueDelivery(context.Background(), client.ClientID, notif)
+		if errors.Is(err, errDeliveryQueueFull) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"message": "Antrian pengiriman penuh, coba lagi sebentar lagi",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Gagal mengantre notifikasi",
+				"error":   err.Error(),
+			})
+		}
 
-	payload := map[string]interface{}{
-		"message": map[string]interface{}{
-			"token": notif.Token,
-			"notification": map[string]string{
-				"title": notif.Title,
-				"body":  notif.Body,
-			},
-			"data": notif.Data,
-		},
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":   "Notifikasi diantre untuk dikirim",
+			"messageId": messageID,
+		})
 	}
 
-	var result map[string]interface{}
+	return sendSync(c, notif)
+}
 
-	resp, err := client.R().
-		SetHeader("Content-Type", "application/json").
-		SetBody(payload).
-		SetResult(&result). // SetResult mengarahkan Resty untuk mem-parsing respons ke dalam `result`
-		Post("https://fcm.googleapis.com/v1/projects/" + os.Getenv("FIREBASE_PROJECT_ID") + "/messages:send")
+// sendMulticast mengirim notif ke setiap token di notif.Tokens secara
+// konkuren dan mengumpulkan successCount/failureCount per token.
+func sendMulticast(c *fiber.Ctx, notif *NotificationRequest) error {
+	results := fcmClient.SendToTokens(context.Background(), notif.Tokens, notif)
+	result := SendResult{Results: results}
+	for _, r := range results {
+		if r.Success {
+			result.SuccessCount++
+		} else {
+			result.FailureCount++
+		}
+	}
 
-	if err != nil {
-		return nil, err
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notifikasi terkirim",
+		"result":  result,
+	})
+}
+
+// sendSync mengirim notif langsung ke FCM (topic/condition/token tunggal)
+// dan menunggu balasannya, dipakai saat ?async=false.
+func sendSync(c *fiber.Ctx, notif *NotificationRequest) error {
+	var (
+		response map[string]interface{}
+		err      error
+	)
+
+	ctx := context.Background()
+	switch {
+	case notif.Topic != "":
+		response, err = fcmClient.SendToTopic(ctx, notif.Topic, notif)
+	case notif.Condition != "":
+		response, err = fcmClient.SendToCondition(ctx, notif.Condition, notif)
+	default:
+		response, err = fcmClient.Send(ctx, notif)
 	}
 
-	if resp.IsError() {
-		return nil, fiber.NewError(resp.StatusCode(), resp.String())
+	if err != nil {
+		log.Printf("Error sending notification: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Gagal mengirim notifikasi",
+			"error":   err.Error(),
+		})
 	}
 
-	// Mengakses hasil yang telah diparse
-	return result, nil
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notifikasi terkirim",
+		"result":  SendResult{SuccessCount: 1, Response: response},
+	})
 }
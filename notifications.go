@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/api/iterator"
+)
+
+// defaultNotificationsTake adalah jumlah notifikasi yang diambil per halaman
+// jika query param take tidak diisi.
+const defaultNotificationsTake = 20
+
+// Notification adalah dokumen yang disimpan di
+// users/{userId}/notifications/{notificationId} setiap kali sebuah
+// notifikasi dikirim, sehingga mobile client bisa menampilkan inbox
+// terlepas dari riwayat notifikasi OS.
+type Notification struct {
+	ID          string            `firestore:"-" json:"id"`
+	Title       string            `firestore:"title" json:"title"`
+	Body        string            `firestore:"body" json:"body"`
+	Data        map[string]string `firestore:"data" json:"data"`
+	Topic       string            `firestore:"topic" json:"topic,omitempty"`
+	IsImportant bool              `firestore:"isImportant" json:"isImportant"`
+	SentAt      time.Time         `firestore:"sentAt" json:"sentAt"`
+	ReadAt      *time.Time        `firestore:"readAt" json:"readAt,omitempty"`
+}
+
+// saveNotification menyimpan salinan notifikasi ke inbox milik userID.
+// Dipanggil dari sendNotificationHandler sebelum notifikasi dikirim atau
+// diantre ke FCM.
+func saveNotification(ctx context.Context, userID string, notif *NotificationRequest) error {
+	doc := Notification{
+		Title:       notif.Title,
+		Body:        notif.Body,
+		Data:        notif.Data,
+		Topic:       notif.Topic,
+		IsImportant: notif.IsImportant,
+		SentAt:      time.Now(),
+	}
+
+	_, _, err := firestoreClient.Collection("users").Doc(userID).Collection("notifications").Add(ctx, doc)
+	return err
+}
+
+// endpoint GET /notifications?userId=&unreadOnly=&take=&offset=
+func listNotificationsHandler(c *fiber.Ctx) error {
+	userID := c.Query("userId")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "userId wajib diisi",
+		})
+	}
+
+	client := c.Locals("client").(*Client)
+	if !client.allowsUser(userID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Client tidak diizinkan mengakses notifikasi user ini",
+		})
+	}
+
+	take := defaultNotificationsTake
+	if v, err := strconv.Atoi(c.Query("take")); err == nil && v > 0 {
+		take = v
+	}
+
+	offset := 0
+	if v, err := strconv.Atoi(c.Query("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	query := firestoreClient.Collection("users").Doc(userID).Collection("notifications").
+		OrderBy("sentAt", firestore.Desc)
+
+	if c.QueryBool("unreadOnly", false) {
+		query = query.Where("readAt", "==", nil)
+	}
+
+	ctx := context.Background()
+	iter := query.Offset(offset).Limit(take).Documents(ctx)
+	defer iter.Stop()
+
+	notifications := make([]Notification, 0, take)
+	for {
+		snap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Gagal mengambil notifikasi",
+				"error":   err.Error(),
+			})
+		}
+
+		var n Notification
+		if err := snap.DataTo(&n); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Gagal mengambil notifikasi",
+				"error":   err.Error(),
+			})
+		}
+		n.ID = snap.Ref.ID
+		notifications = append(notifications, n)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       "OK",
+		"notifications": notifications,
+	})
+}
+
+// endpoint POST /notifications/:id/read?userId=
+func markNotificationReadHandler(c *fiber.Ctx) error {
+	userID := c.Query("userId")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "userId wajib diisi",
+		})
+	}
+
+	client := c.Locals("client").(*Client)
+	if !client.allowsUser(userID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Client tidak diizinkan mengakses notifikasi user ini",
+		})
+	}
+
+	notificationID := c.Params("id")
+
+	ctx := context.Background()
+	_, err := firestoreClient.Collection("users").Doc(userID).Collection("notifications").Doc(notificationID).
+		Update(ctx, []firestore.Update{{Path: "readAt", Value: time.Now()}})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Gagal menandai notifikasi sebagai dibaca",
+			"error":   err.Error(),
+		})
+	}
+
+	// Gema read-receipt ke socket lain milik user yang sama (mis. notifikasi
+	// dibaca di HP, badge di web langsung ikut hilang).
+	hub.broadcast(userID, fiber.Map{
+		"event":          "notification.read",
+		"notificationId": notificationID,
+	})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notifikasi ditandai sebagai dibaca",
+	})
+}
+
+// endpoint POST /notifications/read-all?userId=
+func markAllNotificationsReadHandler(c *fiber.Ctx) error {
+	userID := c.Query("userId")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "userId wajib diisi",
+		})
+	}
+
+	client := c.Locals("client").(*Client)
+	if !client.allowsUser(userID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Client tidak diizinkan mengakses notifikasi user ini",
+		})
+	}
+
+	ctx := context.Background()
+	iter := firestoreClient.Collection("users").Doc(userID).Collection("notifications").
+		Where("readAt", "==", nil).Documents(ctx)
+	defer iter.Stop()
+
+	now := time.Now()
+	count := 0
+	for {
+		snap, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Gagal menandai semua notifikasi sebagai dibaca",
+				"error":   err.Error(),
+			})
+		}
+
+		if _, err := snap.Ref.Update(ctx, []firestore.Update{{Path: "readAt", Value: now}}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Gagal menandai semua notifikasi sebagai dibaca",
+				"error":   err.Error(),
+			})
+		}
+		count++
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Semua notifikasi ditandai sebagai dibaca",
+		"count":   count,
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// safeConn membungkus *websocket.Conn dengan mutex sendiri, karena
+// fasthttp/websocket tidak aman dipakai untuk menulis secara konkuren ke
+// socket yang sama (mis. broadcast FCM dan echo read-receipt yang terjadi
+// bersamaan) — menulis tanpa kunci bisa panic dan merusak koneksi.
+type safeConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (s *safeConn) writeJSON(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.WriteJSON(v)
+}
+
+// realtimeHub menyimpan koneksi WebSocket yang sedang terbuka per userID,
+// supaya notifikasi bisa didorong langsung ke client foreground tanpa
+// menunggu FCM (mis. web/desktop yang tidak punya registrasi FCM).
+type realtimeHub struct {
+	mu    sync.RWMutex
+	conns map[string][]*safeConn
+}
+
+var hub = &realtimeHub{conns: make(map[string][]*safeConn)}
+
+// register menambahkan koneksi baru untuk userID.
+func (h *realtimeHub) register(userID string, conn *safeConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[userID] = append(h.conns[userID], conn)
+}
+
+// remove melepas koneksi milik userID, dipanggil saat socket ditutup.
+func (h *realtimeHub) remove(userID string, conn *safeConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns := h.conns[userID]
+	for i, c := range conns {
+		if c == conn {
+			h.conns[userID] = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(h.conns[userID]) == 0 {
+		delete(h.conns, userID)
+	}
+}
+
+// broadcast mengirim payload ke setiap socket terbuka milik userID, dan
+// melepas socket yang sudah putus. Penulisan ke setiap socket diserialkan
+// lewat mutex-nya sendiri di safeConn, jadi aman dipanggil konkuren dari
+// sendNotificationHandler dan markNotificationReadHandler sekaligus.
+func (h *realtimeHub) broadcast(userID string, payload interface{}) {
+	h.mu.RLock()
+	conns := append([]*safeConn(nil), h.conns[userID]...)
+	h.mu.RUnlock()
+
+	for _, conn := range conns {
+		if err := conn.writeJSON(payload); err != nil {
+			log.Printf("Error pushing realtime payload to user %s: %v\n", userID, err)
+			h.remove(userID, conn)
+		}
+	}
+}
+
+// wsUpgradeMiddleware hanya mengizinkan request upgrade WebSocket lewat,
+// mengotentikasi caller lewat client_id/client_secret di query string (JS
+// browser tidak bisa mengirim header Authorization saat upgrade), dan
+// memastikan client itu diizinkan bertindak atas nama userId yang diminta
+// sebelum socket didaftarkan ke hub.
+func wsUpgradeMiddleware(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	userID := c.Query("userId")
+	client, err := authenticateCredentials(c)
+	if err != nil || !client.allowsUser(userID) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	c.Locals("userId", userID)
+	return c.Next()
+}
+
+// endpoint /ws/notifications
+func wsNotificationsHandler() fiber.Handler {
+	return websocket.New(func(c *websocket.Conn) {
+		userID, _ := c.Locals("userId").(string)
+		if userID == "" {
+			_ = c.Close()
+			return
+		}
+
+		conn := &safeConn{Conn: c}
+		hub.register(userID, conn)
+		defer hub.remove(userID, conn)
+
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				break
+			}
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Endpoint Instance ID API untuk mengelola keanggotaan topic.
+const (
+	iidBatchAddURL    = "https://iid.googleapis.com/iid/v1:batchAdd"
+	iidBatchRemoveURL = "https://iid.googleapis.com/iid/v1:batchRemove"
+)
+
+// SubscriptionRequest dipakai oleh /subscribe dan /unsubscribe untuk
+// mendaftarkan atau melepas sekumpulan token dari sebuah topic.
+type SubscriptionRequest struct {
+	Tokens []string `json:"tokens" validate:"required,min=1"`
+	Topic  string   `json:"topic" validate:"required"`
+}
+
+// Subscribe mendaftarkan tokens ke topic lewat IID batchAdd.
+func (f *FCMClient) Subscribe(ctx context.Context, topic string, tokens []string) (map[string]interface{}, error) {
+	return f.manageSubscription(ctx, iidBatchAddURL, topic, tokens, false)
+}
+
+// Unsubscribe melepas tokens dari topic lewat IID batchRemove.
+func (f *FCMClient) Unsubscribe(ctx context.Context, topic string, tokens []string) (map[string]interface{}, error) {
+	return f.manageSubscription(ctx, iidBatchRemoveURL, topic, tokens, false)
+}
+
+// manageSubscription memanggil IID batchAdd/batchRemove dengan bearer token
+// OAuth2, dan mencoba ulang sekali dengan token baru jika IID membalas 401.
+func (f *FCMClient) manageSubscription(ctx context.Context, url, topic string, tokens []string, forceRefresh bool) (map[string]interface{}, error) {
+	token, err := f.accessToken(ctx, forceRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := map[string]interface{}{
+		"to":                  "/topics/" + topic,
+		"registration_tokens": tokens,
+	}
+
+	var result map[string]interface{}
+	resp, err := f.resty.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Authorization", "Bearer "+token).
+		SetHeader("access_token_auth", "true").
+		SetBody(payload).
+		SetResult(&result).
+		Post(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() == fiber.StatusUnauthorized && !forceRefresh {
+		return f.manageSubscription(ctx, url, topic, tokens, true)
+	}
+
+	if resp.IsError() {
+		return nil, fiber.NewError(resp.StatusCode(), resp.String())
+	}
+
+	return result, nil
+}
+
+// endpoint /subscribe
+func subscribeHandler(c *fiber.Ctx) error {
+	return subscriptionHandler(c, fcmClient.Subscribe, "Berhasil subscribe ke topic")
+}
+
+// endpoint /unsubscribe
+func unsubscribeHandler(c *fiber.Ctx) error {
+	return subscriptionHandler(c, fcmClient.Unsubscribe, "Berhasil unsubscribe dari topic")
+}
+
+// subscriptionHandler memuat dan memvalidasi SubscriptionRequest, lalu
+// menjalankan action (Subscribe/Unsubscribe) terhadap IID API.
+func subscriptionHandler(c *fiber.Ctx, action func(ctx context.Context, topic string, tokens []string) (map[string]interface{}, error), successMessage string) error {
+	req := new(SubscriptionRequest)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	if err := validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	client := c.Locals("client").(*Client)
+	if !client.allowsTopic(req.Topic) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Client tidak diizinkan mengelola topic ini",
+		})
+	}
+
+	response, err := action(context.Background(), req.Topic, req.Tokens)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": fmt.Sprintf("Gagal mengubah subscription topic %s", req.Topic),
+			"error":   err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  successMessage,
+		"response": response,
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/gofiber/contrib/otelfiber"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+)
+
+// tracer dipakai untuk span kustom di atas otelfiber, mis. akuisisi token
+// OAuth2 dan panggilan Resty keluar ke FCM.
+var tracer = otel.Tracer("fcm-gofiber-backend")
+
+// Metrik Prometheus yang diekspos lewat /metrics supaya operator bisa
+// alert saat FCM error spike atau Firestore melambat.
+var (
+	fcmSendTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fcm_send_total",
+		Help: "Total percobaan pengiriman FCM, dipecah berdasarkan hasil (success/error).",
+	}, []string{"result"})
+
+	fcmSendLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fcm_send_latency_seconds",
+		Help:    "Latensi satu panggilan pengiriman FCM, termasuk percobaan ulang 401.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+
+	firestoreOpLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "firestore_op_latency_seconds",
+		Help:    "Latensi operasi Firestore, dipecah berdasarkan nama operasi.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"op"})
+)
+
+func init() {
+	prometheus.MustRegister(fcmSendTotal, fcmSendLatency, firestoreOpLatency)
+}
+
+// metricsHandler mengadaptasi promhttp.Handler (net/http) ke fiber.Handler.
+func metricsHandler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// withFirestoreSpan membungkus satu operasi Firestore dengan span serta
+// histogram firestore_op_latency_seconds.
+func withFirestoreSpan(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, "firestore."+op)
+	defer span.End()
+
+	start := time.Now()
+	err := fn(ctx)
+	firestoreOpLatency.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// restyHeaderCarrier mengadaptasi header resty.Request menjadi
+// propagation.TextMapCarrier agar trace context bisa disisipkan.
+type restyHeaderCarrier struct {
+	req *resty.Request
+}
+
+func (c restyHeaderCarrier) Get(key string) string {
+	return c.req.Header.Get(key)
+}
+
+func (c restyHeaderCarrier) Set(key, value string) {
+	c.req.SetHeader(key, value)
+}
+
+func (c restyHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.req.Header))
+	for k := range c.req.Header {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// injectTraceHeaders menyisipkan trace context dari ctx ke header request
+// resty, supaya bisa disambung di sisi penerima (mis. FCM mencatatnya di log).
+func injectTraceHeaders(ctx context.Context, req *resty.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, restyHeaderCarrier{req: req})
+}
+
+// tracingMiddleware membungkus setiap request dengan span otelfiber.
+func tracingMiddleware() fiber.Handler {
+	return otelfiber.Middleware()
+}
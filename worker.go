@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errDeliveryQueueFull menandakan antrian pengiriman async penuh (mis. saat
+// thundering-herd karena gangguan FCM), supaya caller bisa membalas 503
+// alih-alih goroutine handler menggantung menunggu slot antrian kosong.
+var errDeliveryQueueFull = errors.New("antrian pengiriman penuh")
+
+// Ukuran worker pool dan antrian pengiriman async, serta batas percobaan
+// sebelum sebuah pesan dipindah ke dead_letters.
+const (
+	deliveryWorkerCount = 4
+	deliveryQueueSize   = 256
+	maxDeliveryAttempts = 5
+)
+
+// DeliveryStatus merepresentasikan status pengiriman async di koleksi
+// `messages`, dicek lewat GET /messages/:id.
+type DeliveryStatus string
+
+const (
+	DeliveryPending DeliveryStatus = "pending"
+	DeliverySent    DeliveryStatus = "sent"
+	DeliveryFailed  DeliveryStatus = "failed"
+)
+
+// MessageRecord adalah dokumen di koleksi `messages` yang melacak progres
+// pengiriman async sebuah notifikasi. ClientID mencatat client yang
+// mengantrekan pesan ini, supaya GET /messages/:id bisa dibatasi ke client
+// pemiliknya alih-alih memperlakukan messageID sebagai bearer token de facto.
+type MessageRecord struct {
+	ID        string         `firestore:"-" json:"id"`
+	ClientID  string         `firestore:"clientId" json:"-"`
+	Status    DeliveryStatus `firestore:"status" json:"status"`
+	Attempts  int            `firestore:"attempts" json:"attempts"`
+	LastError string         `firestore:"lastError,omitempty" json:"lastError,omitempty"`
+	CreatedAt time.Time      `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time      `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// deliveryJob adalah satu unit kerja di antrian worker: kirim notif ke
+// target tunggal (token/topic/condition) yang sudah dipilih oleh handler.
+type deliveryJob struct {
+	messageID string
+	notif     *NotificationRequest
+}
+
+var deliveryQueue chan deliveryJob
+
+// startDeliveryWorkers menyiapkan antrian terbatas dan menjalankan n worker
+// goroutine yang membacanya. Dipanggil sekali dari main.
+func startDeliveryWorkers(n int) {
+	deliveryQueue = make(chan deliveryJob, deliveryQueueSize)
+	for i := 0; i < n; i++ {
+		go deliveryWorkerLoop()
+	}
+}
+
+func deliveryWorkerLoop() {
+	for job := range deliveryQueue {
+		processDeliveryJob(job)
+	}
+}
+
+// enqueueDelivery membuat record `messages` berstatus pending, dicap dengan
+// clientID yang mengantrekannya, lalu memasukkan job ke antrian.
+// Mengembalikan messageID untuk dipakai klien polling GET /messages/:id.
+// Pengiriman ke channel tidak memblokir: jika antrian penuh, mengembalikan
+// errDeliveryQueueFull alih-alih menunggu slot kosong, supaya goroutine
+// handler HTTP tidak menggantung tak terbatas saat thundering-herd (mis.
+// gangguan FCM) mengisi penuh antrian.
+func enqueueDelivery(ctx context.Context, clientID string, notif *NotificationRequest) (string, error) {
+	ref := firestoreClient.Collection("messages").NewDoc()
+	now := time.Now()
+
+	record := MessageRecord{
+		ClientID:  clientID,
+		Status:    DeliveryPending,
+		Attempts:  0,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := ref.Set(ctx, record); err != nil {
+		return "", err
+	}
+
+	select {
+	case deliveryQueue <- deliveryJob{messageID: ref.ID, notif: notif}:
+		return ref.ID, nil
+	default:
+		return "", errDeliveryQueueFull
+	}
+}
+
+// processDeliveryJob mengirim job ke FCM, mencoba ulang dengan exponential
+// backoff plus jitter pada error yang retryable, dan menghormati header
+// Retry-After. Percobaan yang akhirnya gagal total ditulis ke dead_letters.
+func processDeliveryJob(job deliveryJob) {
+	ctx := context.Background()
+
+	var lastErr error
+	attempts := 0
+	for attempt := 1; attempt <= maxDeliveryAttempts; attempt++ {
+		attempts = attempt
+		_, err := deliverSingle(ctx, job.notif)
+		if err == nil {
+			updateMessageStatus(ctx, job.messageID, DeliverySent, attempt, "")
+			return
+		}
+
+		lastErr = err
+		if !isRetryableDeliveryError(err) || attempt == maxDeliveryAttempts {
+			break
+		}
+
+		time.Sleep(backoffDelay(attempt, retryAfterOf(err)))
+	}
+
+	updateMessageStatus(ctx, job.messageID, DeliveryFailed, attempts, lastErr.Error())
+	writeDeadLetter(ctx, job.messageID, job.notif, lastErr)
+}
+
+// deliverSingle mengirim ke satu-satunya jenis target yang didukung jalur
+// async: token tunggal, topic, atau condition (fan out ke banyak token tetap
+// lewat jalur sinkron SendToTokens agar hasil per-token bisa langsung
+// dikembalikan ke caller).
+func deliverSingle(ctx context.Context, notif *NotificationRequest) (map[string]interface{}, error) {
+	switch {
+	case notif.Topic != "":
+		return fcmClient.SendToTopic(ctx, notif.Topic, notif)
+	case notif.Condition != "":
+		return fcmClient.SendToCondition(ctx, notif.Condition, notif)
+	default:
+		return fcmClient.Send(ctx, notif)
+	}
+}
+
+func isRetryableDeliveryError(err error) bool {
+	fcmErr, ok := err.(*FCMError)
+	if !ok {
+		// Error jaringan/transport (bukan balasan HTTP dari FCM) dianggap
+		// sementara dan layak dicoba ulang.
+		return true
+	}
+	return fcmErr.Retryable()
+}
+
+func retryAfterOf(err error) time.Duration {
+	if fcmErr, ok := err.(*FCMError); ok {
+		return fcmErr.RetryAfter
+	}
+	return 0
+}
+
+// backoffDelay menghitung jeda sebelum percobaan berikutnya: exponential
+// backoff (1s, 2s, 4s, ...) plus jitter, dinaikkan ke Retry-After jika FCM
+// meminta jeda yang lebih lama.
+func backoffDelay(attempt int, retryAfter time.Duration) time.Duration {
+	base := time.Duration(1<<uint(attempt-1)) * time.Second
+	jitter := time.Duration(rand.Int63n(int64(base)/2 + 1))
+	delay := base + jitter
+
+	if retryAfter > delay {
+		return retryAfter
+	}
+	return delay
+}
+
+func updateMessageStatus(ctx context.Context, messageID string, status DeliveryStatus, attempts int, lastError string) {
+	updates := []firestore.Update{
+		{Path: "status", Value: status},
+		{Path: "attempts", Value: attempts},
+		{Path: "updatedAt", Value: time.Now()},
+	}
+	if lastError != "" {
+		updates = append(updates, firestore.Update{Path: "lastError", Value: lastError})
+	}
+
+	if _, err := firestoreClient.Collection("messages").Doc(messageID).Update(ctx, updates); err != nil {
+		log.Printf("Error updating message %s status: %v\n", messageID, err)
+	}
+}
+
+// writeDeadLetter menyimpan notifikasi yang gagal total (error yang tidak
+// retryable, atau masih gagal setelah maxDeliveryAttempts kali percobaan),
+// berikut error terakhirnya, supaya bisa diperiksa atau dikirim ulang manual.
+func writeDeadLetter(ctx context.Context, messageID string, notif *NotificationRequest, lastErr error) {
+	_, err := firestoreClient.Collection("dead_letters").Doc(messageID).Set(ctx, fiber.Map{
+		"notification": notif,
+		"lastError":    lastErr.Error(),
+		"failedAt":     time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error writing dead letter for message %s: %v\n", messageID, err)
+	}
+}
+
+// endpoint GET /messages/:id
+func getMessageStatusHandler(c *fiber.Ctx) error {
+	ctx := context.Background()
+	snap, err := firestoreClient.Collection("messages").Doc(c.Params("id")).Get(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Pesan tidak ditemukan",
+		})
+	}
+
+	var record MessageRecord
+	if err := snap.DataTo(&record); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Gagal membaca status pesan",
+			"error":   err.Error(),
+		})
+	}
+	record.ID = snap.Ref.ID
+
+	// Batasi akses ke client yang mengantrekan pesan ini, supaya messageID
+	// tidak jadi bearer token de facto bagi siapa pun yang menebak/memperoleh
+	// ID-nya.
+	client := c.Locals("client").(*Client)
+	if record.ClientID != client.ClientID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Client tidak diizinkan mengakses pesan ini",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "OK",
+		"result":  record,
+	})
+}
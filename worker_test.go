@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay_WithinJitterBounds(t *testing.T) {
+	cases := []struct {
+		name    string
+		attempt int
+		base    time.Duration
+	}{
+		{"attempt 1", 1, 1 * time.Second},
+		{"attempt 2", 2, 2 * time.Second},
+		{"attempt 3", 3, 4 * time.Second},
+		{"attempt 4", 4, 8 * time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			maxDelay := tc.base + tc.base/2
+			for i := 0; i < 50; i++ {
+				delay := backoffDelay(tc.attempt, 0)
+				if delay < tc.base || delay > maxDelay {
+					t.Fatalf("backoffDelay(%d, 0) = %v, want in [%v, %v]", tc.attempt, delay, tc.base, maxDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffDelay_HonoursRetryAfterWhenLonger(t *testing.T) {
+	delay := backoffDelay(1, 10*time.Second)
+	if delay != 10*time.Second {
+		t.Fatalf("backoffDelay(1, 10s) = %v, want 10s", delay)
+	}
+}
+
+func TestBackoffDelay_IgnoresRetryAfterWhenShorterThanBackoff(t *testing.T) {
+	delay := backoffDelay(4, 1*time.Second)
+	if delay < 8*time.Second {
+		t.Fatalf("backoffDelay(4, 1s) = %v, want >= base backoff 8s", delay)
+	}
+}